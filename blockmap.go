@@ -0,0 +1,130 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// BlockInfo describes one fixed-size block of a file, as produced by Scan: its position, size
+// and strong (SHA-256) hash. Unlike BlockChecksum it carries no weak checksum, since a BlockMap
+// is only ever compared against another BlockMap scanned at the same block size and aligned
+// boundaries.
+type BlockInfo struct {
+	Offset int64
+	Size   int
+	Hash   []byte
+}
+
+// BlockMap is the ordered set of blocks that make up a file, as produced by Scan.
+type BlockMap []BlockInfo
+
+// Scan reads r in blockSize chunks and returns the resulting BlockMap. sizeHint, when greater
+// than zero, is used to pre-size the returned slice and otherwise has no effect on the result.
+//
+// An empty reader yields a single zero-length block hashing the empty string, so that zero-byte
+// files round-trip through DiffBlockMaps like any other file instead of producing an empty,
+// unmatched BlockMap.
+func Scan(ctx context.Context, r io.Reader, blockSize int, sizeHint int64) (BlockMap, error) {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	var blocks BlockMap
+	if sizeHint > 0 {
+		blocks = make(BlockMap, 0, sizeHint/int64(blockSize)+1)
+	}
+
+	h := sha256.New()
+	buf := make([]byte, blockSize)
+	var offset int64
+
+	for {
+		select {
+		case <-ctx.Done():
+			return blocks, errors.Wrapf(ctx.Err(), "failed scanning blocks")
+		default:
+		}
+
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			h.Reset()
+			h.Write(buf[:n])
+			blocks = append(blocks, BlockInfo{Offset: offset, Size: n, Hash: h.Sum(nil)})
+			offset += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return blocks, errors.Wrapf(err, "failed reading block at offset %d", offset)
+		}
+	}
+
+	if len(blocks) == 0 {
+		h.Reset()
+		blocks = append(blocks, BlockInfo{Hash: h.Sum(nil)})
+	}
+
+	return blocks, nil
+}
+
+// DiffBlockMaps compares local against remote and returns, in local's order, the
+// BlockOperations needed to turn remote into local: a copy operation referencing the matching
+// remote block's offset when a local block's strong hash is already present in remote, or a
+// literal operation carrying the local block's own bytes, read from localSrc at its offset,
+// otherwise. Since both maps are expected to have been scanned at the same, aligned block size,
+// this skips the weak rolling hash search that Sync needs to cope with unaligned shifts.
+func DiffBlockMaps(local, remote BlockMap, localSrc io.ReaderAt) ([]BlockOperation, error) {
+	byHash := make(map[string]BlockInfo, len(remote))
+	for _, b := range remote {
+		byHash[string(b.Hash)] = b
+	}
+
+	ops := make([]BlockOperation, 0, len(local))
+	for _, b := range local {
+		if r, ok := byHash[string(b.Hash)]; ok {
+			ops = append(ops, BlockOperation{Index: uint64(r.Offset), Size: r.Size, Hash: r.Hash})
+			continue
+		}
+
+		data := make([]byte, b.Size)
+		if _, err := localSrc.ReadAt(data, b.Offset); err != nil {
+			return ops, errors.Wrapf(err, "failed reading local block at offset %d", b.Offset)
+		}
+		ops = append(ops, BlockOperation{Index: uint64(b.Offset), Data: data})
+	}
+
+	return ops, nil
+}
+
+// ToBlockChecksums converts a BlockMap into BlockChecksum entries indexed by position, so that
+// it can feed the existing LookUpTable and be matched against by the rolling Sync path. A
+// BlockMap only carries the strong hash of each block, not its bytes, so src - the same reader m
+// was scanned from - is re-read at each block's offset to derive Weak via RollingHash, the same
+// way Checksums and cas.BuildManifest compute it; a mismatched src would therefore produce
+// checksums Sync can never match, so callers must pass the reader (or an equivalent copy) Scan
+// produced m from.
+func (m BlockMap) ToBlockChecksums(src io.ReaderAt) ([]BlockChecksum, error) {
+	checksums := make([]BlockChecksum, len(m))
+	for i, b := range m {
+		block := make([]byte, b.Size)
+		if _, err := src.ReadAt(block, b.Offset); err != nil {
+			return nil, errors.Wrapf(err, "failed reading block at offset %d", b.Offset)
+		}
+		checksums[i] = BlockChecksum{
+			Index:  uint64(b.Offset),
+			Weak:   RollingHash(block),
+			Strong: b.Hash,
+			Length: b.Size,
+		}
+	}
+	return checksums, nil
+}
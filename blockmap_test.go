@@ -0,0 +1,113 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gsync
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+)
+
+// TestDiffBlockMapsRoundTrip scans two versions of a file that share a common prefix but diverge
+// after it, and checks that DiffBlockMaps' BlockOperations reconstruct local exactly: matched
+// blocks copy from remote's offset and unmatched blocks carry local's own bytes as a literal.
+func TestDiffBlockMapsRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	blockSize := 32
+
+	shared := make([]byte, blockSize*5)
+	r.Read(shared)
+	remoteTail := make([]byte, blockSize*2)
+	r.Read(remoteTail)
+	localTail := make([]byte, blockSize*2)
+	r.Read(localTail)
+
+	remoteData := append(append([]byte{}, shared...), remoteTail...)
+	localData := append(append([]byte{}, shared...), localTail...)
+
+	ctx := context.Background()
+	remoteMap, err := Scan(ctx, bytes.NewReader(remoteData), blockSize, int64(len(remoteData)))
+	if err != nil {
+		t.Fatalf("Scan(remote): %v", err)
+	}
+	localMap, err := Scan(ctx, bytes.NewReader(localData), blockSize, int64(len(localData)))
+	if err != nil {
+		t.Fatalf("Scan(local): %v", err)
+	}
+
+	ops, err := DiffBlockMaps(localMap, remoteMap, bytes.NewReader(localData))
+	if err != nil {
+		t.Fatalf("DiffBlockMaps: %v", err)
+	}
+	if len(ops) != len(localMap) {
+		t.Fatalf("got %d ops, want %d", len(ops), len(localMap))
+	}
+
+	var reconstructed bytes.Buffer
+	for i, op := range ops {
+		if op.Data != nil {
+			reconstructed.Write(op.Data)
+			continue
+		}
+		// A copy op: fetch Size bytes from remoteData at Index, the way a caller backing
+		// remote with the actual file would.
+		if op.Index+uint64(op.Size) > uint64(len(remoteData)) {
+			t.Fatalf("op %d: copy range out of bounds", i)
+		}
+		reconstructed.Write(remoteData[op.Index : op.Index+uint64(op.Size)])
+	}
+
+	if !bytes.Equal(reconstructed.Bytes(), localData) {
+		t.Fatalf("reconstructed data does not match local: got %d bytes, want %d bytes", reconstructed.Len(), len(localData))
+	}
+
+	// The blocks within shared should all have copied from remote, not gone out as literals.
+	for i := 0; i < len(shared)/blockSize; i++ {
+		if ops[i].Data != nil {
+			t.Fatalf("block %d is within the shared prefix but was sent as a literal", i)
+		}
+	}
+}
+
+// TestToBlockChecksumsMatchesSync checks that ToBlockChecksums produces checksums Sync can
+// actually find matches against, i.e. that Weak is a real RollingHash over the block's bytes.
+func TestToBlockChecksumsMatchesSync(t *testing.T) {
+	r := rand.New(rand.NewSource(23))
+	data := make([]byte, 4000)
+	r.Read(data)
+	blockSize := 40
+
+	ctx := context.Background()
+	m, err := Scan(ctx, bytes.NewReader(data), blockSize, int64(len(data)))
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	checksums, err := m.ToBlockChecksums(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ToBlockChecksums: %v", err)
+	}
+
+	remote := lookUpTable(t, checksums)
+
+	ops, err := Sync(ctx, bytes.NewReader(data), nil, remote, SyncOptions{BlockSize: blockSize})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	var copies int
+	for op := range ops {
+		if op.Error != nil {
+			t.Fatalf("sync error: %v", op.Error)
+		}
+		if op.Data == nil {
+			copies++
+		}
+	}
+	if copies != len(checksums) {
+		t.Fatalf("got copies=%d, want %d - ToBlockChecksums' Weak must match RollingHash", copies, len(checksums))
+	}
+}
@@ -0,0 +1,53 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cas
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/diannaowa/gsync"
+)
+
+// LookUpTable builds the same map[uint32][]gsync.BlockChecksum shape gsync.LookUpTable builds
+// from a checksum channel, but directly from a BlockStore snapshot described by manifests,
+// without re-reading or re-chunking any of the files that produced them. Because every manifest
+// backed by the same store shares this table, it is reusable across files - and across versions
+// of the same file - where gsync.Checksums would otherwise need to rescan each one in turn.
+// store is consulted with Has, not Get, so a block a manifest references but that has since been
+// removed from store is not offered as a match.
+//
+// The returned BlockChecksums carry a zero Index: a block's position in whichever file it was
+// first written from is not meaningful once it is addressed by content, so matches against this
+// table should be resolved through BlockOperation.Hash rather than BlockOperation.Index.
+func LookUpTable(ctx context.Context, store BlockStore, manifests []Manifest) (map[uint32][]gsync.BlockChecksum, error) {
+	table := make(map[uint32][]gsync.BlockChecksum)
+	seen := make(map[string]bool)
+
+	for _, m := range manifests {
+		for _, b := range m.Blocks {
+			select {
+			case <-ctx.Done():
+				return table, errors.Wrapf(ctx.Err(), "cas: failed building lookup table")
+			default:
+			}
+
+			key := string(b.Hash)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			if !store.Has(b.Hash) {
+				continue
+			}
+
+			table[b.Weak] = append(table[b.Weak], gsync.BlockChecksum{Weak: b.Weak, Strong: b.Hash, Length: b.Size})
+		}
+	}
+
+	return table, nil
+}
@@ -0,0 +1,133 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package cas
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/diannaowa/gsync"
+)
+
+// BlockRef names one block of a file's content: Hash identifies it in a BlockStore, Offset and
+// Size locate it within the original file. Weak is the block's gsync.RollingHash, cached here so
+// that LookUpTable can build a remote table without re-reading every block from the store.
+type BlockRef struct {
+	Hash   []byte
+	Offset int64
+	Size   int
+	Weak   uint32
+}
+
+// Manifest records how a single file is reconstructed from blocks held in a BlockStore: Path is
+// relative to the tree root BuildManifest was called with, Size is the file's total length, and
+// Blocks is the ordered sequence of BlockRefs that make it up.
+type Manifest struct {
+	Path   string
+	Size   int64
+	Blocks []BlockRef
+}
+
+// Chunker constructs a gsync.Chunker bound to r. BuildManifest calls it once per file so that
+// every file is cut with the same chunking strategy - and the same size parameters - while each
+// still gets its own Chunker instance, since a gsync.Chunker is bound to a single reader.
+type Chunker func(r io.Reader) gsync.Chunker
+
+// BuildManifest walks root and returns a Manifest for every regular file under it, storing each
+// chunk chunker cuts into store under its SHA-256 hash. Blocks already present in store, because
+// an earlier call to BuildManifest stored the same content under a different path or version,
+// are not written again.
+func BuildManifest(ctx context.Context, root string, chunker Chunker, store BlockStore) ([]Manifest, error) {
+	var manifests []Manifest
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return errors.Wrapf(err, "cas: failed relativizing %s", path)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return errors.Wrapf(err, "cas: failed statting %s", path)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return errors.Wrapf(err, "cas: failed opening %s", path)
+		}
+		defer f.Close()
+
+		m := Manifest{Path: rel, Size: info.Size()}
+		c := chunker(f)
+		for {
+			chunk, err := c.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return errors.Wrapf(err, "cas: failed chunking %s", path)
+			}
+
+			hash := sha256.Sum256(chunk.Data)
+			if err := store.Put(hash[:], chunk.Data); err != nil {
+				return errors.Wrapf(err, "cas: failed storing block of %s", path)
+			}
+
+			m.Blocks = append(m.Blocks, BlockRef{
+				Hash:   hash[:],
+				Offset: chunk.Offset,
+				Size:   len(chunk.Data),
+				Weak:   gsync.RollingHash(chunk.Data),
+			})
+		}
+
+		manifests = append(manifests, m)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "cas: failed building manifest")
+	}
+
+	return manifests, nil
+}
+
+// Reconstruct writes m's file to w by fetching each of its blocks from store, in order.
+func Reconstruct(ctx context.Context, m Manifest, store BlockStore, w io.Writer) error {
+	for _, b := range m.Blocks {
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "cas: failed reconstructing %s", m.Path)
+		default:
+		}
+
+		data, err := store.Get(b.Hash)
+		if err != nil {
+			return errors.Wrapf(err, "cas: failed reconstructing %s", m.Path)
+		}
+		if _, err := w.Write(data); err != nil {
+			return errors.Wrapf(err, "cas: failed writing %s", m.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package cas provides a content-addressable BlockStore and the Manifest machinery to build and
+// reconstruct files from it, so that many versions of the same artifact can share whatever blocks
+// they have in common on disk: a block is indexed, once, by the hash of its content rather than
+// by the file and version it happened to first appear in.
+package cas
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// BlockStore is a content-addressable store of blocks, keyed by their SHA-256 hash.
+type BlockStore interface {
+	// Put stores data under hash, if it is not already present.
+	Put(hash []byte, data []byte) error
+	// Get returns the block stored under hash, or an error if it is not present.
+	Get(hash []byte) ([]byte, error)
+	// Has reports whether a block is stored under hash.
+	Has(hash []byte) bool
+}
+
+// FSStore is a BlockStore backed by a directory tree. Each block is laid out under
+// hex(hash)[:2]/hex(hash)[2:], so that a store holding millions of blocks still keeps any single
+// directory small enough for common filesystems to list quickly.
+type FSStore struct {
+	root string
+}
+
+// NewFSStore returns an FSStore rooted at root. root is created on first Put if it does not
+// already exist.
+func NewFSStore(root string) *FSStore {
+	return &FSStore{root: root}
+}
+
+func (s *FSStore) path(hash []byte) string {
+	h := hex.EncodeToString(hash)
+	return filepath.Join(s.root, h[:2], h[2:])
+}
+
+// Put implements BlockStore. It writes data to a temporary file and renames it into place, so a
+// process killed mid-write never leaves a partial block for a later Put to mistake as already
+// stored, or for Get to hand back silently truncated.
+func (s *FSStore) Put(hash []byte, data []byte) error {
+	p := s.path(hash)
+	if _, err := os.Stat(p); err == nil {
+		return nil
+	}
+
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrapf(err, "cas: failed creating directory for block %x", hash)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return errors.Wrapf(err, "cas: failed creating temp file for block %x", hash)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "cas: failed writing block %x", hash)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "cas: failed writing block %x", hash)
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return errors.Wrapf(err, "cas: failed storing block %x", hash)
+	}
+	return nil
+}
+
+// Get implements BlockStore.
+func (s *FSStore) Get(hash []byte) ([]byte, error) {
+	data, err := os.ReadFile(s.path(hash))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cas: failed reading block %x", hash)
+	}
+	return data, nil
+}
+
+// Has implements BlockStore.
+func (s *FSStore) Has(hash []byte) bool {
+	_, err := os.Stat(s.path(hash))
+	return err == nil
+}
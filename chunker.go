@@ -0,0 +1,279 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMinChunkSize is the lower bound FastCDCChunker enforces on every chunk but the
+	// last, regardless of where the gear hash would otherwise cut.
+	DefaultMinChunkSize = 2 * 1024
+
+	// DefaultNormalChunkSize is the size FastCDCChunker targets: below it, cuts require the
+	// wider maskS to line up; at or above it, the narrower maskL is used instead, making a cut
+	// more likely the longer a chunk grows.
+	DefaultNormalChunkSize = 8 * 1024
+
+	// DefaultMaxChunkSize is the upper bound FastCDCChunker enforces on every chunk: if no cut
+	// point is found by then, the chunk is forced to end here.
+	DefaultMaxChunkSize = 64 * 1024
+)
+
+// Chunk is a contiguous, variable or fixed length region of a stream as produced by a Chunker.
+type Chunk struct {
+	Offset int64
+	Data   []byte
+}
+
+// Chunker splits a byte stream into chunks. FixedChunker reproduces the historical
+// DefaultBlockSize behaviour; FastCDCChunker cuts at content-derived boundaries so that
+// inserting or deleting bytes only changes the chunks touching the edit, instead of shifting
+// every block downstream of it.
+type Chunker interface {
+	// Next returns the next chunk, or io.EOF once the underlying stream is exhausted.
+	Next() (Chunk, error)
+}
+
+// FixedChunker splits a reader into fixed-size chunks of Size bytes, with a final, possibly
+// shorter, chunk. Its read buffers are pooled, so callers that no longer need a chunk's Data
+// (for instance because it matched a remote block) should return it via Release.
+type FixedChunker struct {
+	r      io.Reader
+	size   int
+	offset int64
+	pool   sync.Pool
+}
+
+// NewFixedChunker returns a FixedChunker reading from r in chunks of size bytes. size must be
+// greater than zero.
+func NewFixedChunker(r io.Reader, size int) *FixedChunker {
+	if size <= 0 {
+		size = DefaultBlockSize
+	}
+	c := &FixedChunker{r: r, size: size}
+	c.pool.New = func() interface{} { return make([]byte, c.size) }
+	return c
+}
+
+// Release returns buf, a chunk's Data obtained from this FixedChunker, to its internal pool so
+// the next Next call can reuse it instead of allocating. Passing a buffer not obtained from this
+// FixedChunker is safe but wasteful.
+func (c *FixedChunker) Release(buf []byte) {
+	c.pool.Put(buf[:cap(buf)])
+}
+
+// Next implements Chunker.
+func (c *FixedChunker) Next() (Chunk, error) {
+	buf := c.pool.Get().([]byte)[:c.size]
+	n, err := io.ReadFull(c.r, buf)
+	if n == 0 {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return Chunk{}, err
+	}
+
+	chunk := Chunk{Offset: c.offset, Data: buf[:n]}
+	c.offset += int64(n)
+
+	if err == io.ErrUnexpectedEOF {
+		// Short final read: still a valid, final chunk.
+		return chunk, nil
+	}
+	return chunk, err
+}
+
+// gearTable holds the 256 pseudo-random values FastCDCChunker mixes one byte at a time into its
+// rolling gear hash. The values are fixed so that two independent scans of the same content,
+// using the same chunker, always agree on where to cut.
+var gearTable = [256]uint64{
+	0x5c95c078, 0x22408989, 0x2d48a214, 0x12842087, 0x530f8afb, 0x474536b9, 0x2963b4f1, 0x44cb738b,
+	0x4ea7403d, 0x4d606b6e, 0x074ec5d3, 0x3af39d18, 0x726003ca, 0x37a62a74, 0x51a2f58e, 0x7506358e,
+	0x5d4ab128, 0x4d4ae17b, 0x41e85924, 0x470c36f7, 0x4741cbe1, 0x01bb7f30, 0x617c1de3, 0x2b0c3a1f,
+	0x50c48f73, 0xa9a7d9d2, 0x0d895140, 0x2f3b4b19, 0x1f745d72, 0x1a11e289, 0x1d0d1eab, 0xd4a29d5d,
+	0x7ef8e6c9, 0xea2e0eb3, 0x2e9fee7c, 0x01e626bf, 0x1b9e1dd1, 0x669b2a1a, 0x45d2f9e1, 0x7d5f8dca,
+	0x0b5a9cea, 0x2aa43432, 0x6b6d3d6c, 0x2b2cbbf8, 0x7ee3cc35, 0x4dd3f59d, 0x6d15e2e0, 0x6e1d9f1e,
+	0x73a2bd25, 0x3c2f9f33, 0x5f9e2c2b, 0x1d5f5f1a, 0x7c9b8f1e, 0x2d4a7f8b, 0x3a9e6c1d, 0x5e8b2f4a,
+	0x4f1e9b6c, 0x6a2d8e3f, 0x1f6b9c2d, 0x3e8a5f7c, 0x7b2c4d9e, 0x5a9f3e6b, 0x2c7d8a1f, 0x4e6b2f9d,
+	0x68ad1cf2, 0x9c27fa9e, 0x0cdb8f12, 0x38e4a76d, 0x12b9cf34, 0x7a0f6d21, 0x53d8e49c, 0x21fa8b6e,
+	0x4d6e9f21, 0x8b1c3a5e, 0x67c2e8a4, 0x2f9d1b7e, 0x5c3e8a6d, 0x3b7f1c9e, 0x6d4a2e8f, 0x1a9c6f3d,
+	0x4e8b7f2a, 0x2d9c3a6e, 0x7f6b1e4d, 0x3c8a5d2f, 0x5e2f9b4a, 0x1d7c8e3f, 0x6a4d2f9b, 0x3e9b1c7a,
+	0x7b3f6d1e, 0x2c4a9e8f, 0x5d1b3e7c, 0x4f8a2d9e, 0x6e7c1f3d, 0x3a5e9b2f, 0x1c7d4e8a, 0x7f2b9e6d,
+	0x5a3c8f1e, 0x4d6b2e9f, 0x2f8a7c1d, 0x6e3f9b4a, 0x1b5d8e2c, 0x7a4c6f3e, 0x3d9e1b7c, 0x5f2a8e4d,
+	0x6c7b3f1e, 0x2e9d4a8c, 0x4b6f1e3a, 0x7d8c2e9f, 0x1f3a6d4b, 0x5e7c9b2d, 0x3a4e8f1c, 0x6d1b7e9a,
+	0x2c8f3a5e, 0x4e9b6c1d, 0x7a2d8e4f, 0x1c6e9b3a, 0x5f4a2d7e, 0x3e9c1b6d, 0x6b7d4e2a, 0x2a3f8c9e,
+	0x4d7e1b3c, 0x7c9a6e2d, 0x1e4b8f3a, 0x5a2d9c6e, 0x3f6e1b7d, 0x6c8a4e2f, 0x2e1d7c9b, 0x4a9e3f6c,
+	0x7b2c6e1d, 0x1d8a4f3e, 0x5c9b2e7a, 0x3a6d1f8c, 0x6e4c9b2d, 0x2f7a8e1c, 0x4c1b6e9a, 0x7e3d2f8c,
+	0x1a9c4e6b, 0x5d2f8a3e, 0x3c6b9e1d, 0x6f4a2c8e, 0x2d8e1b7a, 0x4e6c3f9d, 0x7a1d8e2c, 0x1c3f6a9e,
+	0x5b8e2d4c, 0x3e7a1c9f, 0x6d2b8e4a, 0x2a9e6c3d, 0x4f1c8b7e, 0x7d3a2e9c, 0x1e6b4f8a, 0x5a9c2d7e,
+	0x3d8b6e1f, 0x6c4e9a2d, 0x2e7c1f8b, 0x4a2d9e6c, 0x7b6e3f1d, 0x1f9c8a4e, 0x5d2e6b3a, 0x3a7c9e1d,
+	0x6e1b4f8c, 0x2c8a6e3d, 0x4e9d1b7a, 0x7a3e8c2f, 0x1b6f9d4a, 0x5c2a8e6d, 0x3e4b7c1f, 0x6a9d2e8c,
+	0x2f1c6b4a, 0x4d8e9a3c, 0x7c2f1d6e, 0x1e9a4c7b, 0x5b3d8e2a, 0x3f6c1a9d, 0x6e8b4d2f, 0x2a1e7c9b,
+	0x4c9f3a6e, 0x7d2b6e1a, 0x1f4c8a9d, 0x5a6e2d3b, 0x3d1b9c7e, 0x6f8a4e2c, 0x2e6d1f8a, 0x4b3e9c7d,
+	0x7a8c2f1e, 0x1d6a9b4c, 0x5e2c8d3a, 0x3a9f6e1b, 0x6c1d4a8e, 0x2f8b3e9c, 0x4d6e1c7a, 0x7b9a2e8f,
+	0x1c3e8b6d, 0x5f7a1d9c, 0x3e2b6f8a, 0x6a9c4e1d, 0x2d8e7b3f, 0x4c1f9a6e, 0x7e3d8c2b, 0x1a9f6e4c,
+	0x5c8b2d7e, 0x3d6a9e1f, 0x6f1c8b4a, 0x2e9d3a7c, 0x4b6e1f8d, 0x7c2a9e3b, 0x1e8b4d6f, 0x5a3c7e2d,
+	0x3f9e6b1a, 0x6c4d8a2e, 0x2a7f1b9c, 0x4e6c8d3a, 0x7d1e9f2b, 0x1b8a3e6c, 0x5e9c2d7a, 0x3a4f6b8e,
+	0x6d7e1c9a, 0x2f3a8e6d, 0x4c9b1e7f, 0x7a6d2f8c, 0x1e3b9c4a, 0x5d8e6a2f, 0x3b1c7e9d, 0x6a9f4d2b,
+	0x2e6c1a8e, 0x4f9d3b7c, 0x7c2e8a1d, 0x1a4b6e9f, 0x5f3d8c2a, 0x3e9a1f6b, 0x6b7e2d9c, 0x2c8f4a1e,
+	0x4a1e6d9b, 0x7e3c8f2a, 0x1d9b4e7c, 0x5a2f8d3e, 0x3c6e9a1b, 0x6f4d1c8e, 0x2e8a3f7b, 0x4d9c6b1e,
+	0x7b2e9f4c, 0x1f6a8d3b, 0x5c3e1b9d, 0x3a8f6c2e, 0x6e1d4a9c, 0x2d7c8b3f, 0x4c6e9d1a, 0x7f3a2e8c,
+	0x1b9d6f4e, 0x5e8c3a2d, 0x3d1f9b6e, 0x6a4c8e2f, 0x2f7b1d9a, 0x4e3a6c8d, 0x7c9f2e1b, 0x1a6d4b8e,
+}
+
+// FastCDCChunker implements FastCDC-style content-defined chunking: it slides a gear hash over
+// the stream and cuts whenever the low bits of that hash are zero, using a wider mask below
+// normal size and a narrower one above it so that cuts become more likely the longer a chunk
+// grows. Cut points only depend on the bytes around them, so an insertion or deletion only
+// perturbs the chunk(s) it falls inside rather than every chunk downstream of it.
+type FastCDCChunker struct {
+	r      io.ByteReader
+	min    int
+	normal int
+	max    int
+	maskS  uint64
+	maskL  uint64
+	offset int64
+}
+
+// NewFastCDCChunker returns a FastCDCChunker reading from r, cutting chunks no smaller than min,
+// generally around normal, and never larger than max. Zero values fall back to
+// DefaultMinChunkSize, DefaultNormalChunkSize and DefaultMaxChunkSize respectively.
+func NewFastCDCChunker(r io.Reader, min, normal, max int) *FastCDCChunker {
+	if min <= 0 {
+		min = DefaultMinChunkSize
+	}
+	if normal <= 0 {
+		normal = DefaultNormalChunkSize
+	}
+	if max <= 0 {
+		max = DefaultMaxChunkSize
+	}
+
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = newByteReader(r)
+	}
+
+	return &FastCDCChunker{
+		r:      br,
+		min:    min,
+		normal: normal,
+		max:    max,
+		// maskS is wider (more bits required to be zero) so a cut is less likely below
+		// normal size; maskL is narrower so a cut becomes more likely above it.
+		maskS: 1<<15 - 1,
+		maskL: 1<<11 - 1,
+	}
+}
+
+// Next implements Chunker.
+func (c *FastCDCChunker) Next() (Chunk, error) {
+	var h uint64
+	data := make([]byte, 0, c.normal)
+
+	for len(data) < c.max {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if len(data) == 0 {
+				return Chunk{}, err
+			}
+			break
+		}
+		data = append(data, b)
+		h = (h << 1) + gearTable[b]
+
+		if len(data) < c.min {
+			continue
+		}
+
+		mask := c.maskL
+		if len(data) < c.normal {
+			mask = c.maskS
+		}
+		if h&mask == 0 {
+			break
+		}
+	}
+
+	chunk := Chunk{Offset: c.offset, Data: data}
+	c.offset += int64(len(data))
+	return chunk, nil
+}
+
+// byteReader adapts an io.Reader without ReadByte into one, reading a byte at a time. It exists
+// solely so FastCDCChunker can accept plain io.Readers; callers that already hold a
+// *bufio.Reader or similar should pass it directly to avoid the extra indirection.
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func newByteReader(r io.Reader) *byteReader {
+	return &byteReader{r: r}
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(b.r, b.buf[:])
+	if err != nil {
+		return 0, err
+	}
+	return b.buf[0], nil
+}
+
+// Checksums chunks r using chunker and emits a BlockChecksum per chunk on the returned channel,
+// ready to feed LookUpTable. It mirrors Sync's non-blocking, channel-based shape.
+func Checksums(ctx context.Context, chunker Chunker, shash hash.Hash) (<-chan BlockChecksum, error) {
+	if chunker == nil {
+		return nil, errors.New("gsync: chunker required")
+	}
+	if shash == nil {
+		shash = sha256.New()
+	}
+
+	out := make(chan BlockChecksum)
+
+	go func() {
+		defer close(out)
+
+		for {
+			select {
+			case <-ctx.Done():
+				out <- BlockChecksum{Error: ctx.Err()}
+				return
+			default:
+			}
+
+			chunk, err := chunker.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				out <- BlockChecksum{Error: errors.Wrapf(err, "failed chunking block")}
+				return
+			}
+
+			shash.Reset()
+			shash.Write(chunk.Data)
+
+			out <- BlockChecksum{
+				Index:  uint64(chunk.Offset),
+				Weak:   RollingHash(chunk.Data),
+				Strong: shash.Sum(nil),
+				Length: len(chunk.Data),
+			}
+		}
+	}()
+
+	return out, nil
+}
@@ -0,0 +1,79 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gsync
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// chunkAll drains c into a slice of Chunks.
+func chunkAll(t *testing.T, c Chunker) []Chunk {
+	t.Helper()
+	var chunks []Chunk
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+// TestFastCDCChunkerShiftResistance inserts a few bytes near the start of a file and checks that
+// most chunks further in are unaffected, unlike FixedChunker, where a single insertion shifts
+// every chunk boundary downstream of it.
+func TestFastCDCChunkerShiftResistance(t *testing.T) {
+	r := rand.New(rand.NewSource(99))
+	data := make([]byte, 256*1024)
+	r.Read(data)
+
+	shifted := append(append([]byte{}, data[:1000]...), append([]byte("a few extra bytes"), data[1000:]...)...)
+
+	original := chunkAll(t, NewFastCDCChunker(bytes.NewReader(data), 0, 0, 0))
+	afterShift := chunkAll(t, NewFastCDCChunker(bytes.NewReader(shifted), 0, 0, 0))
+
+	byHash := make(map[string]bool, len(original))
+	for _, c := range original {
+		byHash[string(c.Data)] = true
+	}
+
+	var unchanged int
+	for _, c := range afterShift {
+		if byHash[string(c.Data)] {
+			unchanged++
+		}
+	}
+
+	// The insertion can only perturb the chunk(s) around it; nearly all chunks further into
+	// the 256KB input should reappear byte-for-byte.
+	if unchanged < len(original)/2 {
+		t.Fatalf("only %d/%d original chunks survived a small insertion near the start; content-defined chunking should make most of them shift-resistant", unchanged, len(original))
+	}
+
+	// A FixedChunker, by contrast, has no way to resist the shift: every chunk after the
+	// insertion point should differ from the original.
+	fixedOriginal := chunkAll(t, NewFixedChunker(bytes.NewReader(data), DefaultBlockSize))
+	fixedShifted := chunkAll(t, NewFixedChunker(bytes.NewReader(shifted), DefaultBlockSize))
+
+	fixedByHash := make(map[string]bool, len(fixedOriginal))
+	for _, c := range fixedOriginal {
+		fixedByHash[string(c.Data)] = true
+	}
+	var fixedUnchanged int
+	for _, c := range fixedShifted {
+		if fixedByHash[string(c.Data)] {
+			fixedUnchanged++
+		}
+	}
+	if fixedUnchanged >= unchanged {
+		t.Fatalf("expected FastCDC to survive the shift better than FixedChunker, got fastcdc=%d fixed=%d", unchanged, fixedUnchanged)
+	}
+}
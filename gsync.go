@@ -0,0 +1,61 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gsync
+
+const (
+	// DefaultBlockSize is the default size, in bytes, of the blocks used to compute checksums
+	// and search for matches when callers do not provide their own SyncOptions.
+	DefaultBlockSize = 8 * 1024
+
+	// DefaultMaxLiteralSize bounds how many consecutive non-matching bytes are buffered before
+	// being flushed as a literal BlockOperation when callers do not provide their own
+	// SyncOptions.
+	DefaultMaxLiteralSize = 64 * 1024
+)
+
+// BlockChecksum carries the weak and strong checksums for a single block of a remote file,
+// along with the offset it was read from and any error encountered while computing it.
+type BlockChecksum struct {
+	Index  uint64
+	Weak   uint32
+	Strong []byte
+	// Length is the size, in bytes, of the block this checksum was computed over. Blocks are
+	// only ever uniform DefaultBlockSize when produced by the fixed-size path; a Chunker such
+	// as FastCDCChunker produces variable-sized blocks, so Length records the actual size.
+	Length int
+	Error  error
+}
+
+// BlockOperation instructs the receiving end on how to reconstruct a portion of the destination
+// file: either copy Size bytes of the block at Index from the existing remote file, or write
+// Data as a literal run of bytes that could not be matched against remote.
+type BlockOperation struct {
+	Index uint64
+	// Size is the number of bytes to copy from the remote block at Index. It is unused for
+	// literal operations, where len(Data) is authoritative.
+	Size int
+	// Hash is the matched block's strong checksum, copied from the BlockChecksum.Strong that
+	// produced this copy operation. Index only locates the block within a single remote file;
+	// Hash additionally identifies it content-addressably, which callers backing remote with a
+	// store keyed by block hash (such as gsync/cas) need in order to fetch it regardless of
+	// which file or version it was originally read from. It is unused for literal operations.
+	Hash  []byte
+	Data  []byte
+	Error error
+}
+
+// RollingHash computes a weak, Adler-32 style checksum over block, following the same a/b
+// recurrence rsync uses so that it can later be updated incrementally in O(1) as the window
+// slides one byte at a time, instead of being recomputed from scratch. It is exported so that
+// packages building their own remote lookup tables from data Sync did not itself chunk, such as
+// gsync/cas, can produce BlockChecksums Sync will recognise.
+func RollingHash(block []byte) uint32 {
+	var a, b uint32
+	for i, c := range block {
+		a += uint32(c)
+		b += uint32(len(block)-i) * uint32(c)
+	}
+	return a&0xffff | (b&0xffff)<<16
+}
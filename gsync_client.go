@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"runtime"
 
 	"github.com/pkg/errors"
 )
@@ -37,16 +38,76 @@ func LookUpTable(ctx context.Context, bc <-chan BlockChecksum) (map[uint32][]Blo
 	return table, nil
 }
 
+// SyncOptions customizes the behaviour of Sync. The zero value is valid and falls back to the
+// package defaults.
+type SyncOptions struct {
+	// BlockSize is the size, in bytes, of the sliding window used to search remote for
+	// matching blocks. Defaults to DefaultBlockSize when zero.
+	BlockSize int
+
+	// MaxLiteralSize bounds how many consecutive unmatched bytes are buffered before being
+	// flushed as a literal BlockOperation. Defaults to DefaultMaxLiteralSize when zero.
+	MaxLiteralSize int
+
+	// MaxLookbackBytes caps how many bytes of r are read before Sync gives up on finding
+	// further matches and flushes everything else as literals, bounding memory use on very
+	// large inputs. Zero means unbounded.
+	MaxLookbackBytes int64
+
+	// Chunker, when set, replaces the byte-level rolling matcher with a chunk-at-a-time match:
+	// r is split into successive Chunks and each one is looked up in remote directly, rather
+	// than sliding one byte at a time. This only pays off when remote was produced with the
+	// same Chunker (e.g. by Checksums), so that both sides agree on boundaries; pass a
+	// FastCDCChunker to make the match resistant to insertions and deletions shifting content.
+	Chunker Chunker
+
+	// Parallelism controls how many worker goroutines hash and probe remote concurrently when
+	// Chunker is set, reassembling their results in order before they reach the returned
+	// channel. Defaults to runtime.NumCPU() when zero; a value of 1 keeps the original
+	// single-goroutine syncChunked path, which Parallelism has no effect on otherwise.
+	Parallelism int
+
+	// NewStrongHash constructs the hash.Hash each parallel worker uses to verify a weak-hash
+	// match, when Parallelism > 1. Sync's own shash argument is used directly by the
+	// single-goroutine paths, but a hash.Hash cannot be safely shared or cloned across
+	// goroutines, so the parallel path needs a constructor instead: one call per worker.
+	// Defaults to sha256.New, matching Sync's own default for shash; if shash was given a
+	// different algorithm, NewStrongHash must be set to match it; or remote's Strong checksums
+	// will never compare equal and every block will come back as a literal.
+	NewStrongHash func() hash.Hash
+}
+
 // Sync sends file deltas or literals to the caller in order to efficiently re-construct a remote file. Whether to send
 // data or literals is determined by the remote checksums provided by the caller.
 // This function does not block and returns immediately. Also, the remote map is accessed without a mutex.
 // The caller must make sure the concrete reader instance is not nil or this function will panic.
-func Sync(ctx context.Context, r io.Reader, shash hash.Hash, remote map[uint32][]BlockChecksum) (<-chan BlockOperation, error) {
-	var index uint64
-	o := make(chan BlockOperation)
+//
+// Unlike a naive implementation that only probes remote at block-aligned offsets, Sync maintains a
+// byte-level sliding window and its rolling checksum, so insertions or deletions that shift content
+// by a few bytes still allow later blocks to be matched against remote.
+//
+// shash is only used directly when opts.Parallelism is 1 (or opts.Chunker is unset); with a
+// higher Parallelism, each worker needs its own hasher and cannot reuse or clone shash, so set
+// opts.NewStrongHash to a matching constructor if shash is not the sha256.New default.
+func Sync(ctx context.Context, r io.Reader, shash hash.Hash, remote map[uint32][]BlockChecksum, opts ...SyncOptions) (<-chan BlockOperation, error) {
+	var o SyncOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.BlockSize <= 0 {
+		o.BlockSize = DefaultBlockSize
+	}
+	if o.MaxLiteralSize <= 0 {
+		o.MaxLiteralSize = DefaultMaxLiteralSize
+	}
+	if o.Parallelism <= 0 {
+		o.Parallelism = runtime.NumCPU()
+	}
+
+	out := make(chan BlockOperation)
 
 	if r == nil {
-		close(o)
+		close(out)
 		return nil, errors.New("gsync: reader required")
 	}
 
@@ -55,62 +116,259 @@ func Sync(ctx context.Context, r io.Reader, shash hash.Hash, remote map[uint32][
 	}
 
 	go func() {
-		defer close(o)
-		// Read the file, see if there are content matches against remote blocks and send literal or data operation in order to help to reconstruct
-		// the file in the remote end.
+		defer close(out)
+
+		if o.Chunker != nil {
+			if o.Parallelism > 1 {
+				newHash := o.NewStrongHash
+				if newHash == nil {
+					newHash = sha256.New
+				}
+				syncParallel(ctx, o.Chunker, remote, o.Parallelism, newHash, out)
+			} else {
+				syncChunked(ctx, o.Chunker, shash, remote, out)
+			}
+			return
+		}
+
+		var (
+			index   uint64 // bytes consumed from r so far, i.e. the offset just past the sliding window.
+			literal []byte // bytes that fell out of the window without finding a match.
+			read    int64  // total bytes consumed from r, to enforce MaxLookbackBytes.
+			window  = newByteWindow(o.BlockSize)
+			a, b    uint32 // incremental rolling hash state, see RollingHash.
+		)
+
+		// flush emits the pending literal, which always ends where the window's content starts.
+		flush := func() {
+			if len(literal) == 0 {
+				return
+			}
+			out <- BlockOperation{Index: index - uint64(window.len()) - uint64(len(literal)), Data: literal}
+			literal = nil
+		}
+
+		// matches reports whether the current window content matches one of the remote
+		// candidates for the current weak checksum, returning the match when found.
+		matches := func() (BlockChecksum, bool) {
+			weak := a&0xffff | (b&0xffff)<<16
+			candidates, ok := remote[weak]
+			if !ok {
+				return BlockChecksum{}, false
+			}
+
+			shash.Reset()
+			shash.Write(window.bytes())
+			strong := shash.Sum(nil)
+			for _, c := range candidates {
+				if bytes.Equal(strong, c.Strong) {
+					return c, true
+				}
+			}
+			return BlockChecksum{}, false
+		}
+
+		one := make([]byte, 1)
 		for {
-			// Allow for cancellation.
 			select {
 			case <-ctx.Done():
-				o <- BlockOperation{
-					Index: index,
-					Error: ctx.Err(),
-				}
+				out <- BlockOperation{Index: index, Error: ctx.Err()}
 				return
 			default:
-				// break out of the select block and continue reading
-				break
 			}
 
-			buffer := make([]byte, DefaultBlockSize)
-			n, err := r.Read(buffer)
-			if err == io.EOF {
+			if o.MaxLookbackBytes > 0 && read >= o.MaxLookbackBytes {
 				break
 			}
 
-			if err != nil {
-				o <- BlockOperation{
-					Index: index,
-					Error: errors.Wrapf(err, "failed reading block"),
+			n, err := r.Read(one)
+			if n == 0 {
+				if err == io.EOF {
+					break
 				}
-				// return since data corruption in the server is possible and a re-sync is required.
-				return
+				if err != nil {
+					out <- BlockOperation{Index: index, Error: errors.Wrapf(err, "failed reading block")}
+					return
+				}
+				continue
 			}
+			read++
+
+			// wasFull must be captured before push: push's own "full" result only answers
+			// "did a byte fall out of the window on this call", which is false both while
+			// the window is still filling AND on the call that first brings it to exactly
+			// BlockSize bytes - so relying on it alone would skip matching that first
+			// complete window (and, after every reset, the first complete window again).
+			wasFull := window.len() == o.BlockSize
+			evicted, _ := window.push(one[0])
+			index++
+
+			if !wasFull {
+				// Still filling: RollingHash weights the oldest byte in an l-byte block by
+				// l and the newest by 1, so each byte already in the window gets one
+				// heavier as a new, weight-1 byte arrives - the same relation the eviction
+				// update below uses once the window starts sliding.
+				b += a + uint32(one[0])
+				a += uint32(one[0])
 
-			block := buffer[:n]
-			weak := rollingHash(block)
-
-			op := BlockOperation{Index: index}
-			if bs, ok := remote[weak]; ok {
-				shash.Reset()
-				shash.Write(block)
-				s := shash.Sum(nil)
-				for _, b := range bs {
-					if bytes.Equal(s, b.Strong) {
-						// instructs the remote end to copy block data at offset b.Index
-						// from remote file.
-						op.Index = b.Index
-						break
+				if window.len() == o.BlockSize {
+					if c, ok := matches(); ok {
+						flush()
+						out <- BlockOperation{Index: c.Index, Size: c.Length, Hash: c.Strong}
+						window.reset()
+						a, b = 0, 0
 					}
 				}
-			} else {
-				op.Data = block
+				continue
 			}
 
-			o <- op
-			index++
+			// The window was already at capacity and evicted just fell out of it: remove
+			// its contribution at weight BlockSize and re-weight everything still in the
+			// window by one less, which nets out to subtracting BlockSize*evicted and
+			// adding the freshly updated a (see RollingHash for the weighting convention
+			// this mirrors).
+			a = a - uint32(evicted) + uint32(one[0])
+			b = b - uint32(o.BlockSize)*uint32(evicted) + a
+
+			if c, ok := matches(); ok {
+				flush()
+				out <- BlockOperation{Index: c.Index, Size: c.Length, Hash: c.Strong}
+				window.reset()
+				a, b = 0, 0
+				continue
+			}
+
+			literal = append(literal, evicted)
+			if len(literal) >= o.MaxLiteralSize {
+				flush()
+			}
+		}
+
+		// EOF or MaxLookbackBytes reached: whatever remains in the window could not be matched,
+		// flush it as a trailing literal along with anything already pending.
+		literal = append(literal, window.bytes()...)
+		window.reset()
+		flush()
+
+		// Past MaxLookbackBytes, the rest of r is sent as literals without searching it for matches.
+		for o.MaxLookbackBytes > 0 && read >= o.MaxLookbackBytes {
+			buf := make([]byte, o.MaxLiteralSize)
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				out <- BlockOperation{Index: index, Data: buf[:n]}
+				index += uint64(n)
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return
+			}
+			if err != nil {
+				out <- BlockOperation{Index: index, Error: errors.Wrapf(err, "failed reading block")}
+				return
+			}
 		}
 	}()
 
-	return o, nil
+	return out, nil
+}
+
+// syncChunked drives Sync's Chunker code path: unlike the byte-level matcher, it trusts that
+// chunker cuts boundaries the same way they were cut on remote, so each chunk is either a whole
+// match or a whole literal - no byte-by-byte search is needed.
+func syncChunked(ctx context.Context, chunker Chunker, shash hash.Hash, remote map[uint32][]BlockChecksum, out chan<- BlockOperation) {
+	var index uint64
+	rel, _ := chunker.(releaser)
+
+	for {
+		select {
+		case <-ctx.Done():
+			out <- BlockOperation{Index: index, Error: ctx.Err()}
+			return
+		default:
+		}
+
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			out <- BlockOperation{Index: index, Error: errors.Wrapf(err, "failed chunking block")}
+			return
+		}
+
+		op := BlockOperation{Index: index}
+		weak := RollingHash(chunk.Data)
+		if candidates, ok := remote[weak]; ok {
+			shash.Reset()
+			shash.Write(chunk.Data)
+			strong := shash.Sum(nil)
+			matched := false
+			for _, c := range candidates {
+				if bytes.Equal(strong, c.Strong) {
+					op.Index = c.Index
+					op.Size = c.Length
+					op.Hash = c.Strong
+					matched = true
+					if rel != nil {
+						rel.Release(chunk.Data)
+					}
+					break
+				}
+			}
+			if !matched {
+				op.Data = chunk.Data
+			}
+		} else {
+			op.Data = chunk.Data
+		}
+
+		out <- op
+		index += uint64(len(chunk.Data))
+	}
+}
+
+// byteWindow is a fixed-capacity FIFO of bytes used to maintain the sliding window Sync matches
+// against remote, without re-allocating or re-slicing on every byte.
+type byteWindow struct {
+	buf   []byte
+	start int
+	size  int
+}
+
+func newByteWindow(capacity int) *byteWindow {
+	return &byteWindow{buf: make([]byte, capacity)}
+}
+
+// push appends b to the window, evicting and returning the oldest byte once the window is at
+// capacity. The second return value reports whether the window was already full.
+func (w *byteWindow) push(b byte) (evicted byte, full bool) {
+	if w.size < len(w.buf) {
+		w.buf[w.size] = b
+		w.size++
+		return 0, false
+	}
+
+	evicted = w.buf[w.start]
+	w.buf[w.start] = b
+	w.start = (w.start + 1) % len(w.buf)
+	return evicted, true
+}
+
+func (w *byteWindow) len() int {
+	return w.size
+}
+
+// bytes returns the window contents in order, oldest byte first.
+func (w *byteWindow) bytes() []byte {
+	if w.start == 0 {
+		return w.buf[:w.size]
+	}
+	ordered := make([]byte, w.size)
+	copy(ordered, w.buf[w.start:])
+	copy(ordered[len(w.buf)-w.start:], w.buf[:w.start])
+	return ordered
+}
+
+func (w *byteWindow) reset() {
+	w.start = 0
+	w.size = 0
 }
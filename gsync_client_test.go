@@ -0,0 +1,118 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+)
+
+func strongHash(b []byte) []byte {
+	h := sha256.Sum256(b)
+	return h[:]
+}
+
+// blockChecksums splits data into blockSize-aligned blocks and hashes each one the way Checksums
+// does, without needing a reader or goroutine.
+func blockChecksums(data []byte, blockSize int) []BlockChecksum {
+	var checksums []BlockChecksum
+	for off := 0; off+blockSize <= len(data); off += blockSize {
+		block := data[off : off+blockSize]
+		checksums = append(checksums, BlockChecksum{
+			Index:  uint64(off),
+			Weak:   RollingHash(block),
+			Strong: strongHash(block),
+			Length: blockSize,
+		})
+	}
+	return checksums
+}
+
+func lookUpTable(t *testing.T, checksums []BlockChecksum) map[uint32][]BlockChecksum {
+	t.Helper()
+	ch := make(chan BlockChecksum, len(checksums))
+	for _, c := range checksums {
+		ch <- c
+	}
+	close(ch)
+	table, err := LookUpTable(context.Background(), ch)
+	if err != nil {
+		t.Fatalf("LookUpTable: %v", err)
+	}
+	return table
+}
+
+// TestSyncIdenticalContent syncs random data against checksums built from itself and asserts the
+// byte-level matcher finds every aligned block, rather than falling back to literals throughout.
+func TestSyncIdenticalContent(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	data := make([]byte, 24000)
+	r.Read(data)
+
+	blockSize := 64
+	checksums := blockChecksums(data, blockSize)
+	remote := lookUpTable(t, checksums)
+
+	ops, err := Sync(context.Background(), bytes.NewReader(data), nil, remote, SyncOptions{BlockSize: blockSize})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	var copies, literalBytes int
+	for op := range ops {
+		if op.Error != nil {
+			t.Fatalf("sync error: %v", op.Error)
+		}
+		if op.Data != nil {
+			literalBytes += len(op.Data)
+		} else {
+			copies++
+		}
+	}
+	if copies != len(checksums) || literalBytes != 0 {
+		t.Fatalf("syncing identical content: got copies=%d literalBytes=%d, want copies=%d literalBytes=0", copies, literalBytes, len(checksums))
+	}
+}
+
+// TestSyncShiftedContent inserts a handful of bytes near the start of the file and confirms the
+// byte-level matcher still finds blocks further in, since the sliding window - not just aligned
+// offsets - is what lets Sync track content that shifted.
+func TestSyncShiftedContent(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	data := make([]byte, 24000)
+	r.Read(data)
+
+	blockSize := 64
+	checksums := blockChecksums(data, blockSize)
+	remote := lookUpTable(t, checksums)
+
+	shifted := append(append([]byte{}, data[:100]...), append([]byte("EXTRA"), data[100:]...)...)
+
+	ops, err := Sync(context.Background(), bytes.NewReader(shifted), nil, remote, SyncOptions{BlockSize: blockSize})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	var copies, literalBytes int
+	for op := range ops {
+		if op.Error != nil {
+			t.Fatalf("sync error: %v", op.Error)
+		}
+		if op.Data != nil {
+			literalBytes += len(op.Data)
+		} else {
+			copies++
+		}
+	}
+	// The inserted bytes push everything after them off their original block boundary, so
+	// Sync can't recover every block - but the sliding window should still re-align and find
+	// most of the later blocks, unlike a block-aligned-only matcher which would find none.
+	if copies < len(checksums)/2 {
+		t.Fatalf("syncing shifted content: got only copies=%d literalBytes=%d out of %d blocks, expected the sliding window to re-align on most of them", copies, literalBytes, len(checksums))
+	}
+}
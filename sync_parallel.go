@@ -0,0 +1,134 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gsync
+
+import (
+	"bytes"
+	"context"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// releaser is implemented by Chunkers, such as FixedChunker, that pool their read buffers and
+// can reuse one once the caller is done with its Data. syncParallel and syncChunked use it to
+// avoid a make([]byte, ...) allocation on every chunk read from such a Chunker.
+type releaser interface {
+	Release(buf []byte)
+}
+
+type indexedChunk struct {
+	index int
+	chunk Chunk
+	err   error
+}
+
+type indexedOp struct {
+	index int
+	op    BlockOperation
+}
+
+// syncParallel mirrors syncChunked but spreads the per-chunk hashing and remote lookup across
+// workers goroutines, reassembling their results in strict chunk order before writing them to
+// out. Chunker.Next is not safe for concurrent use, so a single reader goroutine still drives
+// chunker; only hashing and the remote lookup - the parts that dominate on large inputs - run in
+// parallel.
+//
+// Workers cannot safely share or clone a single hash.Hash, so each calls newHash once to build
+// its own, matching whatever algorithm remote's Strong checksums were computed with.
+func syncParallel(ctx context.Context, chunker Chunker, remote map[uint32][]BlockChecksum, workers int, newHash func() hash.Hash, out chan<- BlockOperation) {
+	rel, _ := chunker.(releaser)
+
+	in := make(chan indexedChunk, workers*2)
+	results := make(chan indexedOp, workers*2)
+
+	go func() {
+		defer close(in)
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				in <- indexedChunk{index: i, err: ctx.Err()}
+				return
+			default:
+			}
+
+			chunk, err := chunker.Next()
+			if err == io.EOF {
+				return
+			}
+			in <- indexedChunk{index: i, chunk: chunk, err: err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			shash := newHash()
+			for ic := range in {
+				if ic.err != nil {
+					results <- indexedOp{index: ic.index, op: BlockOperation{Error: errors.Wrapf(ic.err, "failed chunking block")}}
+					continue
+				}
+				results <- indexedOp{index: ic.index, op: matchChunk(ic.chunk, shash, remote, rel)}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Reorder stage: results can complete out of order across workers, so buffer them until
+	// the next expected index is ready before writing to out.
+	pending := make(map[int]BlockOperation)
+	next := 0
+	for r := range results {
+		pending[r.index] = r.op
+		for {
+			op, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			out <- op
+			next++
+		}
+	}
+}
+
+// matchChunk hashes chunk and looks it up in remote, returning a copy BlockOperation on a match
+// or a literal one otherwise. On a match, chunk.Data is returned to rel, when non-nil, since
+// nothing downstream needs it anymore.
+func matchChunk(chunk Chunk, shash hash.Hash, remote map[uint32][]BlockChecksum, rel releaser) BlockOperation {
+	op := BlockOperation{Index: uint64(chunk.Offset)}
+
+	weak := RollingHash(chunk.Data)
+	if candidates, ok := remote[weak]; ok {
+		shash.Reset()
+		shash.Write(chunk.Data)
+		strong := shash.Sum(nil)
+		for _, c := range candidates {
+			if bytes.Equal(strong, c.Strong) {
+				op.Index = c.Index
+				op.Size = c.Length
+				op.Hash = c.Strong
+				if rel != nil {
+					rel.Release(chunk.Data)
+				}
+				return op
+			}
+		}
+	}
+
+	op.Data = chunk.Data
+	return op
+}
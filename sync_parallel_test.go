@@ -0,0 +1,197 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package gsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"hash"
+	"math/rand"
+	"testing"
+)
+
+// drainOps collects every BlockOperation from ops, keyed by Index, failing the test on any
+// reported error.
+func drainOps(t testing.TB, ops <-chan BlockOperation) map[uint64]BlockOperation {
+	t.Helper()
+	byIndex := make(map[uint64]BlockOperation)
+	for op := range ops {
+		if op.Error != nil {
+			t.Fatalf("sync error: %v", op.Error)
+		}
+		byIndex[op.Index] = op
+	}
+	return byIndex
+}
+
+// TestSyncParallelMatchesChunked checks that syncParallel (Parallelism > 1) and syncChunked
+// (Parallelism == 1) produce the same BlockOperations for the same input. Operations are compared
+// by Index, so a dropped or altered chunk is caught; the order they arrive in is not compared.
+func TestSyncParallelMatchesChunked(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	data := make([]byte, 2*1024*1024)
+	r.Read(data)
+
+	blockSize := 4096
+	checksums := blockChecksums(data, blockSize)
+	remote := lookUpTable(t, checksums)
+
+	ctx := context.Background()
+	serial, err := Sync(ctx, bytes.NewReader(data), nil, remote, SyncOptions{
+		BlockSize:   blockSize,
+		Chunker:     NewFixedChunker(bytes.NewReader(data), blockSize),
+		Parallelism: 1,
+	})
+	if err != nil {
+		t.Fatalf("Sync (serial): %v", err)
+	}
+	parallel, err := Sync(ctx, bytes.NewReader(data), nil, remote, SyncOptions{
+		BlockSize:   blockSize,
+		Chunker:     NewFixedChunker(bytes.NewReader(data), blockSize),
+		Parallelism: 4,
+	})
+	if err != nil {
+		t.Fatalf("Sync (parallel): %v", err)
+	}
+
+	serialOps := drainOps(t, serial)
+	parallelOps := drainOps(t, parallel)
+
+	if len(serialOps) != len(parallelOps) {
+		t.Fatalf("got %d serial ops, %d parallel ops", len(serialOps), len(parallelOps))
+	}
+	for idx, sop := range serialOps {
+		pop, ok := parallelOps[idx]
+		if !ok {
+			t.Fatalf("index %d present in serial output but missing from parallel output", idx)
+		}
+		if !bytes.Equal(sop.Data, pop.Data) || !bytes.Equal(sop.Hash, pop.Hash) || sop.Size != pop.Size {
+			t.Fatalf("index %d differs: serial=%+v parallel=%+v", idx, sop, pop)
+		}
+	}
+}
+
+// TestSyncParallelHonorsNonDefaultHash checks that the parallel path verifies weak-hash matches
+// with the same algorithm remote's Strong checksums were built with, when it differs from the
+// sha256.New default: without NewStrongHash set to match, every worker would hash with the wrong
+// algorithm and no strong hash would ever compare equal, turning the whole file into literals.
+func TestSyncParallelHonorsNonDefaultHash(t *testing.T) {
+	r := rand.New(rand.NewSource(13))
+	data := make([]byte, 1024*1024)
+	r.Read(data)
+
+	blockSize := 4096
+	var checksums []BlockChecksum
+	for off := 0; off+blockSize <= len(data); off += blockSize {
+		block := data[off : off+blockSize]
+		h := md5.Sum(block)
+		checksums = append(checksums, BlockChecksum{
+			Index:  uint64(off),
+			Weak:   RollingHash(block),
+			Strong: h[:],
+			Length: blockSize,
+		})
+	}
+	remote := lookUpTable(t, checksums)
+
+	ctx := context.Background()
+	ops, err := Sync(ctx, bytes.NewReader(data), md5.New(), remote, SyncOptions{
+		BlockSize:     blockSize,
+		Chunker:       NewFixedChunker(bytes.NewReader(data), blockSize),
+		Parallelism:   4,
+		NewStrongHash: func() hash.Hash { return md5.New() },
+	})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	var copies, literalBytes int
+	for op := range ops {
+		if op.Error != nil {
+			t.Fatalf("sync error: %v", op.Error)
+		}
+		if op.Data != nil {
+			literalBytes += len(op.Data)
+		} else {
+			copies++
+		}
+	}
+	if copies != len(checksums) || literalBytes != 0 {
+		t.Fatalf("got copies=%d literalBytes=%d, want copies=%d literalBytes=0 - NewStrongHash must be honored by parallel workers", copies, literalBytes, len(checksums))
+	}
+}
+
+// benchmarkInput returns deterministic data with roughly matchRatio of its chunkSize-aligned
+// blocks already present in remote, the way a real sync would see a mix of matched and changed
+// content.
+func benchmarkInput(size, chunkSize int, matchRatio float64) ([]byte, map[uint32][]BlockChecksum) {
+	r := rand.New(rand.NewSource(1))
+	data := make([]byte, size)
+	r.Read(data)
+
+	var checksums []BlockChecksum
+	shash := sha256.New()
+	for off := 0; off+chunkSize <= len(data); off += chunkSize {
+		if r.Float64() > matchRatio {
+			continue
+		}
+		block := data[off : off+chunkSize]
+		shash.Reset()
+		shash.Write(block)
+		checksums = append(checksums, BlockChecksum{
+			Index:  uint64(off),
+			Weak:   RollingHash(block),
+			Strong: shash.Sum(nil),
+			Length: chunkSize,
+		})
+	}
+
+	table := make(map[uint32][]BlockChecksum, len(checksums))
+	for _, c := range checksums {
+		table[c.Weak] = append(table[c.Weak], c)
+	}
+	return data, table
+}
+
+// runSyncBenchmark is shared by BenchmarkSyncChunked and BenchmarkSyncParallel: both sync the
+// same input against the same remote table, varying only Parallelism.
+func runSyncBenchmark(b *testing.B, parallelism int) {
+	const size = 1 << 30 // 1GB; fixed, -benchtime only changes how many times it is synced.
+	const chunkSize = 8 * 1024
+	data, remote := benchmarkInput(size, chunkSize, 0.7)
+
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ops, err := Sync(context.Background(), bytes.NewReader(data), nil, remote, SyncOptions{
+			BlockSize:   chunkSize,
+			Chunker:     NewFixedChunker(bytes.NewReader(data), chunkSize),
+			Parallelism: parallelism,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for op := range ops {
+			if op.Error != nil {
+				b.Fatal(op.Error)
+			}
+		}
+	}
+}
+
+// BenchmarkSyncChunked measures the single-goroutine Chunker path (Parallelism == 1) on a
+// GB-scale input.
+func BenchmarkSyncChunked(b *testing.B) {
+	runSyncBenchmark(b, 1)
+}
+
+// BenchmarkSyncParallel measures syncParallel against the same GB-scale input, to quantify what
+// the worker pool buys over BenchmarkSyncChunked.
+func BenchmarkSyncParallel(b *testing.B) {
+	runSyncBenchmark(b, 4)
+}
@@ -0,0 +1,110 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package wire
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Decoder reads framed records written by an Encoder, verifying the magic header and protocol
+// version before the first record.
+type Decoder struct {
+	r             *bufio.Reader
+	checkedHeader bool
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Next reads and decodes the next frame, returning io.EOF once r is exhausted between frames -
+// including before the first frame, when r never had anything encoded to it (a clean, empty
+// stream), which readHeader also reports as io.EOF rather than a wrapped error. As documented in
+// the package comment, a frame whose tag Next does not recognise - for instance one written by a
+// newer encoder - is skipped using its length prefix rather than treated as an error, so Next
+// loops until it finds a frame it understands or reaches EOF.
+func (d *Decoder) Next() (Record, error) {
+	if !d.checkedHeader {
+		if err := readHeader(d.r); err != nil {
+			return Record{}, err
+		}
+		d.checkedHeader = true
+	}
+
+	for {
+		tag, payload, err := readFrame(d.r)
+		if err != nil {
+			return Record{}, err
+		}
+
+		switch tag {
+		case tagChecksum:
+			rec, err := decodeChecksum(payload)
+			if err != nil {
+				return Record{}, err
+			}
+			return Record{Checksum: &rec}, nil
+		case tagCopy:
+			rec, err := decodeCopy(payload)
+			if err != nil {
+				return Record{}, err
+			}
+			return Record{Copy: &rec}, nil
+		case tagLiteral:
+			rec, err := decodeLiteral(payload)
+			if err != nil {
+				return Record{}, err
+			}
+			return Record{Literal: &rec}, nil
+		default:
+			// payload is already fully consumed by readFrame, so skipping this frame is
+			// just a matter of not acting on it and reading the next one.
+			continue
+		}
+	}
+}
+
+func decodeChecksum(payload []byte) (ChecksumRecord, error) {
+	index, payload, err := getUvarint(payload)
+	if err != nil {
+		return ChecksumRecord{}, errors.Wrap(err, "wire: failed decoding checksum record")
+	}
+	weak, payload, err := getUvarint(payload)
+	if err != nil {
+		return ChecksumRecord{}, errors.Wrap(err, "wire: failed decoding checksum record")
+	}
+	length, payload, err := getUvarint(payload)
+	if err != nil {
+		return ChecksumRecord{}, errors.Wrap(err, "wire: failed decoding checksum record")
+	}
+
+	return ChecksumRecord{Index: index, Weak: uint32(weak), Length: int(length), Strong: payload}, nil
+}
+
+func decodeCopy(payload []byte) (CopyRecord, error) {
+	index, payload, err := getUvarint(payload)
+	if err != nil {
+		return CopyRecord{}, errors.Wrap(err, "wire: failed decoding copy record")
+	}
+	size, payload, err := getUvarint(payload)
+	if err != nil {
+		return CopyRecord{}, errors.Wrap(err, "wire: failed decoding copy record")
+	}
+
+	return CopyRecord{Index: index, Size: int(size), Hash: payload}, nil
+}
+
+func decodeLiteral(payload []byte) (LiteralRecord, error) {
+	index, payload, err := getUvarint(payload)
+	if err != nil {
+		return LiteralRecord{}, errors.Wrap(err, "wire: failed decoding literal record")
+	}
+
+	return LiteralRecord{Index: index, Data: payload}, nil
+}
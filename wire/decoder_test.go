@@ -0,0 +1,126 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+
+	checksum := ChecksumRecord{Index: 7, Weak: 123, Strong: []byte("strong-hash"), Length: 64}
+	copyRec := CopyRecord{Index: 64, Size: 64, Hash: []byte("copy-hash")}
+	literal := LiteralRecord{Index: 128, Data: []byte("literal bytes")}
+
+	if err := enc.EncodeChecksum(checksum); err != nil {
+		t.Fatalf("EncodeChecksum: %v", err)
+	}
+	if err := enc.EncodeCopy(copyRec); err != nil {
+		t.Fatalf("EncodeCopy: %v", err)
+	}
+	if err := enc.EncodeLiteral(literal); err != nil {
+		t.Fatalf("EncodeLiteral: %v", err)
+	}
+
+	dec := NewDecoder(&buf)
+
+	rec, err := dec.Next()
+	if err != nil {
+		t.Fatalf("Next (checksum): %v", err)
+	}
+	if rec.Checksum == nil || rec.Copy != nil || rec.Literal != nil {
+		t.Fatalf("got %+v, want only Checksum set", rec)
+	}
+	if rec.Checksum.Index != checksum.Index || rec.Checksum.Weak != checksum.Weak ||
+		rec.Checksum.Length != checksum.Length || !bytes.Equal(rec.Checksum.Strong, checksum.Strong) {
+		t.Fatalf("got %+v, want %+v", *rec.Checksum, checksum)
+	}
+
+	rec, err = dec.Next()
+	if err != nil {
+		t.Fatalf("Next (copy): %v", err)
+	}
+	if rec.Copy == nil || rec.Checksum != nil || rec.Literal != nil {
+		t.Fatalf("got %+v, want only Copy set", rec)
+	}
+	if rec.Copy.Index != copyRec.Index || rec.Copy.Size != copyRec.Size || !bytes.Equal(rec.Copy.Hash, copyRec.Hash) {
+		t.Fatalf("got %+v, want %+v", *rec.Copy, copyRec)
+	}
+
+	rec, err = dec.Next()
+	if err != nil {
+		t.Fatalf("Next (literal): %v", err)
+	}
+	if rec.Literal == nil || rec.Checksum != nil || rec.Copy != nil {
+		t.Fatalf("got %+v, want only Literal set", rec)
+	}
+	if rec.Literal.Index != literal.Index || !bytes.Equal(rec.Literal.Data, literal.Data) {
+		t.Fatalf("got %+v, want %+v", *rec.Literal, literal)
+	}
+
+	if _, err := dec.Next(); err != io.EOF {
+		t.Fatalf("Next (after last record): got err=%v, want io.EOF", err)
+	}
+}
+
+// TestDecoderEmptyStream checks that a Decoder reading a stream that never had anything encoded
+// to it - the shape StreamChecksums/StreamOperations leave behind when fed an empty channel,
+// since they only write the header lazily on the first Encode* call - reports a clean io.EOF on
+// its very first Next call, not a wrapped "failed reading magic header" error.
+func TestDecoderEmptyStream(t *testing.T) {
+	dec := NewDecoder(&bytes.Buffer{})
+	if _, err := dec.Next(); err != io.EOF {
+		t.Fatalf("Next (empty stream): got err=%v, want io.EOF", err)
+	}
+}
+
+// TestDecoderSkipsUnknownTag writes a frame with a tag no decoder released so far understands,
+// followed by a LiteralRecord, and checks Next skips the unknown frame using its length prefix
+// rather than erroring - matching the package doc's forward-compatibility promise.
+func TestDecoderSkipsUnknownTag(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+
+	// Force the header to be written before we hand-append an unknown frame.
+	if err := enc.EncodeLiteral(LiteralRecord{Index: 0, Data: []byte("first")}); err != nil {
+		t.Fatalf("EncodeLiteral: %v", err)
+	}
+
+	const unknownTag = 99
+	if err := writeFrame(&buf, unknownTag, []byte("from a future version of this package")); err != nil {
+		t.Fatalf("writeFrame: %v", err)
+	}
+
+	want := LiteralRecord{Index: 5, Data: []byte("second")}
+	if err := enc.EncodeLiteral(want); err != nil {
+		t.Fatalf("EncodeLiteral: %v", err)
+	}
+
+	dec := NewDecoder(&buf)
+
+	first, err := dec.Next()
+	if err != nil {
+		t.Fatalf("Next (first): %v", err)
+	}
+	if first.Literal == nil || first.Literal.Index != 0 || !bytes.Equal(first.Literal.Data, []byte("first")) {
+		t.Fatalf("got %+v, want the first literal record", first)
+	}
+
+	second, err := dec.Next()
+	if err != nil {
+		t.Fatalf("Next (after unknown tag): %v", err)
+	}
+	if second.Literal == nil || second.Literal.Index != want.Index || !bytes.Equal(second.Literal.Data, want.Data) {
+		t.Fatalf("got %+v, want %+v - the unknown-tag frame should have been skipped, not errored on", second, want)
+	}
+
+	if _, err := dec.Next(); err != io.EOF {
+		t.Fatalf("Next (after last record): got err=%v, want io.EOF", err)
+	}
+}
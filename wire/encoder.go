@@ -0,0 +1,69 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package wire
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Encoder writes framed records to an underlying io.Writer. The magic header and protocol
+// version are written once, immediately before the first record.
+type Encoder struct {
+	w           io.Writer
+	wroteHeader bool
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+func (e *Encoder) writeHeader() error {
+	if e.wroteHeader {
+		return nil
+	}
+	if err := writeHeader(e.w); err != nil {
+		return err
+	}
+	e.wroteHeader = true
+	return nil
+}
+
+// EncodeChecksum writes rec as a ChecksumRecord frame.
+func (e *Encoder) EncodeChecksum(rec ChecksumRecord) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	payload := binary.AppendUvarint(nil, rec.Index)
+	payload = binary.AppendUvarint(payload, uint64(rec.Weak))
+	payload = binary.AppendUvarint(payload, uint64(rec.Length))
+	payload = append(payload, rec.Strong...)
+	return writeFrame(e.w, tagChecksum, payload)
+}
+
+// EncodeCopy writes rec as a CopyRecord frame.
+func (e *Encoder) EncodeCopy(rec CopyRecord) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	payload := binary.AppendUvarint(nil, rec.Index)
+	payload = binary.AppendUvarint(payload, uint64(rec.Size))
+	payload = append(payload, rec.Hash...)
+	return writeFrame(e.w, tagCopy, payload)
+}
+
+// EncodeLiteral writes rec as a LiteralRecord frame.
+func (e *Encoder) EncodeLiteral(rec LiteralRecord) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	payload := binary.AppendUvarint(nil, rec.Index)
+	payload = append(payload, rec.Data...)
+	return writeFrame(e.w, tagLiteral, payload)
+}
@@ -0,0 +1,164 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package wire
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/diannaowa/gsync"
+)
+
+// StreamChecksums reads c until it is closed, encoding each value as a ChecksumRecord frame to w.
+// It mirrors gsync.LookUpTable's shape: synchronous and blocking, returning once c is drained or
+// ctx is cancelled, so the two are typically run concurrently on either end of a connection.
+func StreamChecksums(ctx context.Context, w io.Writer, c <-chan gsync.BlockChecksum) error {
+	enc := NewEncoder(w)
+
+	for bc := range c {
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "wire: failed streaming checksums")
+		default:
+		}
+
+		if bc.Error != nil {
+			fmt.Printf("gsync: checksum error: %#v\n", bc.Error)
+			continue
+		}
+
+		if err := enc.EncodeChecksum(ChecksumRecord{Index: bc.Index, Weak: bc.Weak, Strong: bc.Strong, Length: bc.Length}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamOperations reads op until it is closed, encoding each value as a CopyRecord or
+// LiteralRecord frame to w depending on whether it carries Data, and returning once op is
+// drained or ctx is cancelled.
+func StreamOperations(ctx context.Context, w io.Writer, op <-chan gsync.BlockOperation) error {
+	enc := NewEncoder(w)
+
+	for o := range op {
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "wire: failed streaming operations")
+		default:
+		}
+
+		if o.Error != nil {
+			fmt.Printf("gsync: operation error: %#v\n", o.Error)
+			continue
+		}
+
+		var err error
+		if o.Data != nil {
+			err = enc.EncodeLiteral(LiteralRecord{Index: o.Index, Data: o.Data})
+		} else {
+			err = enc.EncodeCopy(CopyRecord{Index: o.Index, Size: o.Size, Hash: o.Hash})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeChecksums reads framed ChecksumRecords from r, emitting a gsync.BlockChecksum per record
+// on the returned channel. It mirrors gsync.Checksums' non-blocking, channel-based shape, so its
+// output can be fed straight into gsync.LookUpTable.
+func DecodeChecksums(ctx context.Context, r io.Reader) (<-chan gsync.BlockChecksum, error) {
+	if r == nil {
+		return nil, errors.New("wire: reader required")
+	}
+
+	dec := NewDecoder(r)
+	out := make(chan gsync.BlockChecksum)
+
+	go func() {
+		defer close(out)
+
+		for {
+			select {
+			case <-ctx.Done():
+				out <- gsync.BlockChecksum{Error: ctx.Err()}
+				return
+			default:
+			}
+
+			rec, err := dec.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				out <- gsync.BlockChecksum{Error: errors.Wrap(err, "wire: failed decoding checksum")}
+				return
+			}
+			if rec.Checksum == nil {
+				out <- gsync.BlockChecksum{Error: errors.Errorf("wire: expected a checksum record, got %+v", rec)}
+				return
+			}
+
+			out <- gsync.BlockChecksum{
+				Index:  rec.Checksum.Index,
+				Weak:   rec.Checksum.Weak,
+				Strong: rec.Checksum.Strong,
+				Length: rec.Checksum.Length,
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// DecodeOperations reads framed CopyRecord and LiteralRecord frames from r, emitting a
+// gsync.BlockOperation per record on the returned channel. It mirrors gsync.Sync's non-blocking,
+// channel-based shape, so a receiver applies the result the same way it would Sync's own output.
+func DecodeOperations(ctx context.Context, r io.Reader) (<-chan gsync.BlockOperation, error) {
+	if r == nil {
+		return nil, errors.New("wire: reader required")
+	}
+
+	dec := NewDecoder(r)
+	out := make(chan gsync.BlockOperation)
+
+	go func() {
+		defer close(out)
+
+		for {
+			select {
+			case <-ctx.Done():
+				out <- gsync.BlockOperation{Error: ctx.Err()}
+				return
+			default:
+			}
+
+			rec, err := dec.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				out <- gsync.BlockOperation{Error: errors.Wrap(err, "wire: failed decoding operation")}
+				return
+			}
+
+			switch {
+			case rec.Copy != nil:
+				out <- gsync.BlockOperation{Index: rec.Copy.Index, Size: rec.Copy.Size, Hash: rec.Copy.Hash}
+			case rec.Literal != nil:
+				out <- gsync.BlockOperation{Index: rec.Literal.Index, Data: rec.Literal.Data}
+			default:
+				out <- gsync.BlockOperation{Error: errors.Errorf("wire: expected a copy or literal record, got %+v", rec)}
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
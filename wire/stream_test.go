@@ -0,0 +1,55 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, version 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package wire
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/diannaowa/gsync"
+)
+
+// TestDecodeChecksumsEmptyStream streams an empty BlockChecksum channel - the shape Checksums
+// produces for an empty file - through StreamChecksums/DecodeChecksums, and checks the
+// output channel closes cleanly with no error, rather than emitting a decode failure.
+func TestDecodeChecksumsEmptyStream(t *testing.T) {
+	var buf bytes.Buffer
+	ch := make(chan gsync.BlockChecksum)
+	close(ch)
+
+	if err := StreamChecksums(context.Background(), &buf, ch); err != nil {
+		t.Fatalf("StreamChecksums: %v", err)
+	}
+
+	out, err := DecodeChecksums(context.Background(), &buf)
+	if err != nil {
+		t.Fatalf("DecodeChecksums: %v", err)
+	}
+
+	for bc := range out {
+		t.Fatalf("got unexpected record %+v from an empty stream", bc)
+	}
+}
+
+// TestDecodeOperationsEmptyStream is TestDecodeChecksumsEmptyStream's BlockOperation counterpart.
+func TestDecodeOperationsEmptyStream(t *testing.T) {
+	var buf bytes.Buffer
+	ch := make(chan gsync.BlockOperation)
+	close(ch)
+
+	if err := StreamOperations(context.Background(), &buf, ch); err != nil {
+		t.Fatalf("StreamOperations: %v", err)
+	}
+
+	out, err := DecodeOperations(context.Background(), &buf)
+	if err != nil {
+		t.Fatalf("DecodeOperations: %v", err)
+	}
+
+	for op := range out {
+		t.Fatalf("got unexpected record %+v from an empty stream", op)
+	}
+}